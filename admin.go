@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Hytm/loader/metrics"
+)
+
+const adminDefaultLimit = 100
+
+// adminQuerier is the subset of *pgxpool.Pool the accounts/anomalies/
+// blocked handlers need, narrowed to an interface so tests can substitute
+// a pgxmock pool instead of a live CockroachDB connection.
+type adminQuerier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// accountView is the JSON shape returned by the accounts inspection
+// endpoints.
+type accountView struct {
+	ID      uuid.UUID `json:"id"`
+	Balance int       `json:"balance"`
+}
+
+type transferView struct {
+	ID          uuid.UUID `json:"id"`
+	Source      uuid.UUID `json:"source"`
+	Destination uuid.UUID `json:"destination"`
+	Amount      int       `json:"amount"`
+}
+
+type anomalyView struct {
+	Source      uuid.UUID `json:"source"`
+	Destination uuid.UUID `json:"destination"`
+	Level       string    `json:"level"`
+}
+
+type blockedView struct {
+	Source uuid.UUID `json:"source"`
+	Reason string    `json:"reason"`
+}
+
+// adminAccountsHandler serves GET /accounts?limit=&after= and
+// GET /accounts/{id}/transfers.
+type adminAccountsHandler struct {
+	pool adminQuerier
+}
+
+func (h adminAccountsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/accounts"), "/")
+	if rest == "" {
+		h.list(w, r)
+		return
+	}
+	if id, ok := strings.CutSuffix(rest, "/transfers"); ok {
+		h.transfers(w, r, strings.Trim(id, "/"))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (h adminAccountsHandler) list(w http.ResponseWriter, r *http.Request) {
+	limit := adminDefaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	var rows pgx.Rows
+	var err error
+	if after := r.URL.Query().Get("after"); after != "" {
+		afterID, parseErr := uuid.Parse(after)
+		if parseErr != nil {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		rows, err = h.pool.Query(r.Context(),
+			"SELECT id, balance FROM accounts WHERE id > $1 ORDER BY id LIMIT $2", afterID, limit)
+	} else {
+		rows, err = h.pool.Query(r.Context(), "SELECT id, balance FROM accounts ORDER BY id LIMIT $1", limit)
+	}
+	if err != nil {
+		log.Println("admin accounts: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	accounts := []accountView{}
+	for rows.Next() {
+		var a accountView
+		if err := rows.Scan(&a.ID, &a.Balance); err != nil {
+			log.Println("admin accounts: ", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		accounts = append(accounts, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+func (h adminAccountsHandler) transfers(w http.ResponseWriter, r *http.Request, id string) {
+	accountID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "invalid account id", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.pool.Query(r.Context(),
+		"SELECT id, source, destination, amount FROM transfers WHERE source = $1 OR destination = $1 ORDER BY id", accountID)
+	if err != nil {
+		log.Println("admin account transfers: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	transfers := []transferView{}
+	for rows.Next() {
+		var t transferView
+		if err := rows.Scan(&t.ID, &t.Source, &t.Destination, &t.Amount); err != nil {
+			log.Println("admin account transfers: ", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		transfers = append(transfers, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// adminAnomaliesHandler serves GET /anomalies?level=&since=.
+type adminAnomaliesHandler struct {
+	pool adminQuerier
+}
+
+func (h adminAnomaliesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := "SELECT source, destination, level FROM anomalies WHERE ($1 = '' OR level = $1) AND ($2::timestamptz IS NULL OR created_at >= $2) ORDER BY created_at DESC LIMIT $3"
+
+	level := r.URL.Query().Get("level")
+	var since *time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		since = &t
+	}
+
+	rows, err := h.pool.Query(r.Context(), query, level, since, adminDefaultLimit)
+	if err != nil {
+		log.Println("admin anomalies: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	anomalies := []anomalyView{}
+	for rows.Next() {
+		var a anomalyView
+		if err := rows.Scan(&a.Source, &a.Destination, &a.Level); err != nil {
+			log.Println("admin anomalies: ", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		anomalies = append(anomalies, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anomalies)
+}
+
+// adminBlockedHandler serves GET /blocked and DELETE /blocked/{id}.
+type adminBlockedHandler struct {
+	pool adminQuerier
+}
+
+func (h adminBlockedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/blocked"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		h.list(w, r)
+	case r.Method == http.MethodDelete && id != "":
+		h.unblock(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h adminBlockedHandler) list(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.pool.Query(r.Context(), "SELECT source, reason FROM blocked_accounts")
+	if err != nil {
+		log.Println("admin blocked: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	blockedAccounts := []blockedView{}
+	for rows.Next() {
+		var b blockedView
+		if err := rows.Scan(&b.Source, &b.Reason); err != nil {
+			log.Println("admin blocked: ", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		blockedAccounts = append(blockedAccounts, b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blockedAccounts)
+}
+
+// unblock removes an account from blocked_accounts, records an audit
+// row, and drops it from the in-memory cache so it takes effect
+// immediately.
+func (h adminBlockedHandler) unblock(w http.ResponseWriter, r *http.Request, id string) {
+	source, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.pool.Exec(r.Context(), "DELETE FROM blocked_accounts WHERE source = $1", source)
+	if err != nil {
+		log.Println("admin unblock: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if _, err := h.pool.Exec(r.Context(),
+		"INSERT INTO blocked_accounts_audit (source, action, actor, created_at) VALUES ($1, 'unblock', $2, now())",
+		source, r.RemoteAddr); err != nil {
+		log.Println("admin unblock audit: ", err)
+	}
+
+	blocked.unblock(source)
+	metrics.BlockedAccounts.Set(float64(blocked.count()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminStatsHandler serves GET /stats, exposing the counters that used
+// to only be printed to the log at shutdown plus DB pool stats.
+type adminStatsHandler struct {
+	pool *pgxpool.Pool
+}
+
+type statsView struct {
+	Transfers           int64          `json:"transfers"`
+	SuspiciousTransfers int64          `json:"suspicious_transfers"`
+	BlockedAccounts     int            `json:"blocked_accounts"`
+	PoolStats           adminPoolStats `json:"pool"`
+}
+
+type adminPoolStats struct {
+	TotalConns    int32 `json:"total_conns"`
+	IdleConns     int32 `json:"idle_conns"`
+	AcquiredConns int32 `json:"acquired_conns"`
+}
+
+func (h adminStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	stat := h.pool.Stat()
+	view := statsView{
+		Transfers:           metrics.TransfersTotal.Value(),
+		SuspiciousTransfers: metrics.SuspiciousTransfersTotal.Value(),
+		BlockedAccounts:     blocked.count(),
+		PoolStats: adminPoolStats{
+			TotalConns:    stat.TotalConns(),
+			IdleConns:     stat.IdleConns(),
+			AcquiredConns: stat.AcquiredConns(),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock"
+)
+
+func newMockAdminPool(t *testing.T) pgxmock.PgxPoolIface {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("pgxmock.NewPool: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+func TestAdminAccountsListDefaultAndAfter(t *testing.T) {
+	mock := newMockAdminPool(t)
+	h := adminAccountsHandler{pool: mock}
+	a1, a2 := uuid.New(), uuid.New()
+
+	mock.ExpectQuery("SELECT id, balance FROM accounts ORDER BY id LIMIT \\$1").
+		WithArgs(adminDefaultLimit).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "balance"}).AddRow(a1, 100))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var accounts []accountView
+	if err := json.Unmarshal(w.Body.Bytes(), &accounts); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].ID != a1 {
+		t.Fatalf("unexpected accounts: %+v", accounts)
+	}
+
+	mock.ExpectQuery("SELECT id, balance FROM accounts WHERE id > \\$1 ORDER BY id LIMIT \\$2").
+		WithArgs(a1, adminDefaultLimit).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "balance"}).AddRow(a2, 200))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts?after="+a1.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	accounts = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &accounts); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].ID != a2 {
+		t.Fatalf("unexpected accounts: %+v", accounts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAdminAccountsListInvalidAfter(t *testing.T) {
+	mock := newMockAdminPool(t)
+	h := adminAccountsHandler{pool: mock}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts?after=not-a-uuid", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", w.Code)
+	}
+}
+
+func TestAdminAccountsTransfersPath(t *testing.T) {
+	mock := newMockAdminPool(t)
+	h := adminAccountsHandler{pool: mock}
+	acct := uuid.New()
+
+	mock.ExpectQuery("SELECT id, source, destination, amount FROM transfers WHERE source = \\$1 OR destination = \\$1 ORDER BY id").
+		WithArgs(acct).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "source", "destination", "amount"}).
+			AddRow(uuid.New(), acct, uuid.New(), 50))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts/"+acct.String()+"/transfers", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var transfers []transferView
+	if err := json.Unmarshal(w.Body.Bytes(), &transfers); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(transfers) != 1 || transfers[0].Source != acct {
+		t.Fatalf("unexpected transfers: %+v", transfers)
+	}
+}
+
+func TestAdminAccountsTransfersInvalidID(t *testing.T) {
+	mock := newMockAdminPool(t)
+	h := adminAccountsHandler{pool: mock}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts/not-a-uuid/transfers", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", w.Code)
+	}
+}
+
+func TestAdminBlockedUnblockDeletesAndAudits(t *testing.T) {
+	blocked = newBlockedSet()
+	mock := newMockAdminPool(t)
+	h := adminBlockedHandler{pool: mock}
+	source := uuid.New()
+	blocked.block(source, "suspicious")
+
+	mock.ExpectExec("DELETE FROM blocked_accounts WHERE source = \\$1").
+		WithArgs(source).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec("INSERT INTO blocked_accounts_audit \\(source, action, actor, created_at\\) VALUES \\(\\$1, 'unblock', \\$2, now\\(\\)\\)").
+		WithArgs(source, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/blocked/"+source.String(), nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if _, ok := blocked.reason(source); ok {
+		t.Fatal("unblock did not drop the account from the in-memory cache")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAdminBlockedUnblockNotFound(t *testing.T) {
+	blocked = newBlockedSet()
+	mock := newMockAdminPool(t)
+	h := adminBlockedHandler{pool: mock}
+	source := uuid.New()
+
+	mock.ExpectExec("DELETE FROM blocked_accounts WHERE source = \\$1").
+		WithArgs(source).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/blocked/"+source.String(), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want 404", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestBlockedSetLoadAllPreservesRacingWriteThrough reproduces the race
+// between a write-through block() call and a concurrent loadAll refresh:
+// if block() fires after the refresh's snapshot was taken but before
+// loadAll applies it, loadAll must not delete the just-added block just
+// because the stale snapshot doesn't contain it yet.
+func TestBlockedSetLoadAllPreservesRacingWriteThrough(t *testing.T) {
+	b := newBlockedSet()
+
+	asOf := b.snapshotSeq()
+	id := uuid.New()
+	b.block(id, "suspicious")
+
+	b.loadAll(map[uuid.UUID]string{}, asOf)
+
+	if _, ok := b.reason(id); !ok {
+		t.Fatal("loadAll un-blocked an account that was blocked after the snapshot was taken")
+	}
+}
+
+// TestBlockedSetLoadAllDeletesStaleEntries checks the normal case still
+// works: an entry present before the snapshot and absent from the fresh
+// rows is removed.
+func TestBlockedSetLoadAllDeletesStaleEntries(t *testing.T) {
+	b := newBlockedSet()
+	id := uuid.New()
+	b.block(id, "suspicious")
+
+	asOf := b.snapshotSeq()
+	b.loadAll(map[uuid.UUID]string{}, asOf)
+
+	if _, ok := b.reason(id); ok {
+		t.Fatal("loadAll kept an entry that predates the snapshot and is absent from it")
+	}
+}
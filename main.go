@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -13,20 +12,28 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Hytm/loader/metrics"
+	"github.com/Hytm/loader/store"
+	"github.com/Hytm/loader/workerpool"
 )
 
 var (
-	accountList         sync.Map
-	port                string = "8000"
-	suspiciousTransfers        = 0
-	transfers                  = 0
+	accountList sync.Map
+	port        string = "8000"
+	blocked     *blockedSet
+	webhooks    *webhookDispatcher
+	db          *store.Store
 )
 
 const (
@@ -41,7 +48,8 @@ const (
 
 type (
 	fraudDetector struct {
-		pool *pgxpool.Pool
+		pool   *pgxpool.Pool
+		ingest *workerpool.Pool
 	}
 	Message struct {
 		Id          string   `json:"id"`
@@ -51,6 +59,135 @@ type (
 	}
 )
 
+// blockedEntry is the value stored per key in blockedSet.m: the reason an
+// account is blocked, plus the write sequence number it was stored at, so
+// loadAll can tell a write-through from after its snapshot was taken apart
+// from one from before it.
+type blockedEntry struct {
+	reason string
+	seq    int64
+}
+
+// blockedSet is an in-memory cache of blocked accounts, keyed by source
+// account id, mirroring the blocked_accounts table so that transferFunds
+// doesn't have to hit CockroachDB on every transfer. It is safe for
+// concurrent use.
+type blockedSet struct {
+	m   sync.Map // uuid.UUID -> blockedEntry
+	seq atomic.Int64
+}
+
+func newBlockedSet() *blockedSet {
+	return &blockedSet{}
+}
+
+// reason returns the block reason for source, and whether it is blocked.
+func (b *blockedSet) reason(source uuid.UUID) (string, bool) {
+	v, ok := b.m.Load(source)
+	if !ok {
+		return "", false
+	}
+	return v.(blockedEntry).reason, true
+}
+
+// block marks source as blocked for reason, to be called write-through
+// whenever a new row is inserted into blocked_accounts so that the next
+// transfer sees it immediately.
+func (b *blockedSet) block(source uuid.UUID, reason string) {
+	b.m.Store(source, blockedEntry{reason: reason, seq: b.seq.Add(1)})
+}
+
+// unblock removes source from the cache, e.g. once it has been
+// un-blocked by an operator.
+func (b *blockedSet) unblock(source uuid.UUID) {
+	b.m.Delete(source)
+}
+
+// count returns the number of accounts currently cached as blocked, used
+// to report the loader_blocked_accounts gauge.
+func (b *blockedSet) count() int {
+	n := 0
+	b.m.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// snapshotSeq returns the current write sequence number. Call it
+// immediately before querying blocked_accounts for a refresh and pass the
+// result to loadAll, so loadAll can recognize write-through calls that
+// raced with the query and avoid undoing them.
+func (b *blockedSet) snapshotSeq() int64 {
+	return b.seq.Load()
+}
+
+// loadAll replaces the cache contents with rows read from
+// blocked_accounts, used for the periodic full refresh. asOf must be the
+// value snapshotSeq returned immediately before the SELECT that produced
+// rows. A cached entry absent from rows is only deleted if it was written
+// at or before asOf; entries written after asOf are a block() write-through
+// that raced with the query (the query's snapshot simply predates them),
+// so they are left alone rather than being incorrectly un-blocked.
+func (b *blockedSet) loadAll(rows map[uuid.UUID]string, asOf int64) {
+	b.m.Range(func(key, value any) bool {
+		if _, ok := rows[key.(uuid.UUID)]; !ok && value.(blockedEntry).seq <= asOf {
+			b.m.Delete(key)
+		}
+		return true
+	})
+	for source, reason := range rows {
+		if existing, ok := b.m.Load(source); ok && existing.(blockedEntry).seq > asOf {
+			continue
+		}
+		b.m.Store(source, blockedEntry{reason: reason, seq: asOf})
+	}
+}
+
+// refreshBlockedSet periodically reloads blocked accounts from pool into
+// b until ctx is done. In a multi-instance deployment this, together with
+// the write-through in blockAccount, is what keeps loader instances
+// coherent; a CockroachDB CHANGEFEED on blocked_accounts could replace the
+// polling with push notifications if the poll interval ever becomes a
+// bottleneck.
+func refreshBlockedSet(ctx context.Context, pool *pgxpool.Pool, b *blockedSet, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	load := func() {
+		asOf := b.snapshotSeq()
+		rows, err := pool.Query(ctx, "SELECT source, reason FROM blocked_accounts")
+		if err != nil {
+			log.Println("blockedSet refresh: ", err)
+			return
+		}
+		defer rows.Close()
+
+		latest := make(map[uuid.UUID]string)
+		for rows.Next() {
+			var source uuid.UUID
+			var reason string
+			if err := rows.Scan(&source, &reason); err != nil {
+				log.Println("blockedSet refresh: ", err)
+				continue
+			}
+			latest[source] = reason
+		}
+		b.loadAll(latest, asOf)
+		metrics.BlockedAccounts.Set(float64(b.count()))
+	}
+
+	load()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			load()
+		}
+	}
+}
+
 func (fd fraudDetector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	buf, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -59,6 +196,7 @@ func (fd fraudDetector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	newLine := []byte{'\n'}
 	ms := bytes.Split(buf, newLine)
+	metrics.IngestBatchSize.Observe(float64(len(ms)))
 	for _, v := range ms {
 		var m Message
 		err := json.Unmarshal(v, &m)
@@ -66,97 +204,155 @@ func (fd fraudDetector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			log.Println("JSON parse error", err.Error())
 			return
 		}
-		go blockAccount(fd.pool, m)
+		accepted := fd.ingest.Submit(func(ctx context.Context, _ *rand.Rand) {
+			blockAccount(fd.pool, m)
+		})
+		if !accepted {
+			http.Error(w, "ingest queue full", http.StatusTooManyRequests)
+			return
+		}
 	}
 }
 
 func blockAccount(pool *pgxpool.Pool, m Message) {
 	//Check anomaly level
+	var anomaly string
 	err := crdbpgx.ExecuteTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		return isAnomaly(context.Background(), tx, m)
+		var err error
+		anomaly, err = isAnomaly(context.Background(), tx, m)
+		return err
 	})
 
 	if err != nil {
 		log.Println(err)
+	} else {
+		recordAnomaly(m, anomaly)
 	}
 
 	//Block account based on anomaly
+	var didBlock bool
 	err = crdbpgx.ExecuteTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		return needToBlockAccount(context.Background(), tx, m.Source)
+		var err error
+		didBlock, err = needToBlockAccount(context.Background(), tx, m.Source)
+		return err
 	})
 
 	if err != nil {
 		log.Println(err)
+	} else if didBlock {
+		recordBlock(m.Source)
 	}
 }
 
-func isAnomaly(ctx context.Context, tx pgx.Tx, m Message) error {
-	var anomaly string
-	err := tx.QueryRow(ctx, "SELECT anomalyLevel($1)", m.Id).Scan(&anomaly)
+// recordAnomaly fires the metrics/webhook side effects for an anomaly that
+// isAnomaly recorded. It runs after ExecuteTx has committed rather than
+// inside its callback, because CockroachDB retries that callback on
+// serialization conflicts and a metric/webhook fired from inside it would
+// be duplicated on every retry.
+func recordAnomaly(m Message, anomaly string) {
+	if anomaly == "" {
+		return
+	}
+	metrics.AnomaliesTotal.WithLabelValues(anomaly).Inc()
+
+	if anomaly == warning || anomaly == alert {
+		webhooks.enqueue(webhookEvent{
+			Event:      eventAnomaly,
+			Account:    m.Source,
+			Level:      anomaly,
+			TransferID: m.Id,
+			Ts:         time.Now(),
+		})
+	}
+}
+
+// recordBlock fires the metrics/cache write-through/webhook side effects
+// for an account needToBlockAccount just blocked. See recordAnomaly for
+// why this has to run after ExecuteTx commits instead of inside it.
+func recordBlock(source string) {
+	metrics.BlocksTotal.Inc()
+
+	// Write-through so the next transfer sees the block without waiting
+	// for the periodic refresh.
+	if id, err := uuid.Parse(source); err == nil {
+		blocked.block(id, reason)
+		metrics.BlockedAccounts.Set(float64(blocked.count()))
+	}
+	webhooks.enqueue(webhookEvent{
+		Event:   eventBlock,
+		Account: source,
+		Reason:  reason,
+		Ts:      time.Now(),
+	})
+}
 
+func isAnomaly(ctx context.Context, tx pgx.Tx, m Message) (string, error) {
+	anomaly, err := db.AnomalyLevel(ctx, tx, m.Id)
 	if err != nil {
-		if err.Error() != "no rows in result set" {
-			return nil
+		if errors.Is(err, store.ErrNoRows) {
+			return "", nil
 		}
-		return err
+		return "", err
 	}
 
 	//Add anomaly to table
 	if anomaly != notAnomaly {
-		if _, err := tx.Exec(ctx, "INSERT INTO anomalies (source, destination, level) VALUES ($1, $2, $3)", m.Source, m.Destination, anomaly); err != nil {
+		if err := db.InsertAnomaly(ctx, tx, m.Source, m.Destination, anomaly); err != nil {
 			log.Println(err)
 		}
 		log.Println(reason)
+		return anomaly, nil
 	}
 
-	return nil
+	return "", nil
 }
 
-func needToBlockAccount(ctx context.Context, tx pgx.Tx, source string) error {
-	rows, err := tx.Query(ctx, "SELECT anomaly_level, count(*) FROM transfers WHERE source = '$1' GROUP BY anomaly_level", source)
+func needToBlockAccount(ctx context.Context, tx pgx.Tx, source string) (bool, error) {
+	counts, err := db.CountAnomaliesBySource(ctx, tx, source)
 	if err != nil {
-		if err.Error() != "no rows in result set" {
-			return nil
+		if errors.Is(err, store.ErrNoRows) {
+			return false, nil
 		}
-		return err
+		return false, err
 	}
 
-	rate := 0
-	for rows.Next() {
-		level := ""
-		count := 0
-		err := rows.Scan(&level, &count)
-		if err != nil {
-			return err
-		}
-		switch level {
-		case warning:
-			rate += count
-		case alert:
-			rate += 5 * count
-		}
-	}
+	rate := counts[warning] + 5*counts[alert]
 
 	//Add account to blocked accounts
 	if rate >= blockThreshold {
-		if _, err := tx.Exec(ctx, "INSERT INTO blocked_accounts (source, reason) VALUES ($1, $2)", source, reason); err != nil {
+		if err := db.InsertBlockedAccount(ctx, tx, source, reason); err != nil {
 			log.Println(err)
-			return err
+			return false, err
 		}
+		return true, nil
 	}
 
-	return nil
+	return false, nil
 }
 
 func main() {
 	duration := flag.Int("d", 1*3600, "number of seconds to run (default 3600)")
-	wait := flag.Int("w", 1000, "wait between order in ms (default 1000)")
 	accountsPtr := flag.Int("a", 100, "number of accounts to create (default 100)")
+	transferWorkers := flag.Int("workers", 10, "number of transfer worker goroutines")
+	tps := flag.Float64("tps", 10, "target transfers per second")
+	ingestWorkers := flag.Int("ingest-workers", 10, "number of ingest worker goroutines")
+	ingestQueue := flag.Int("ingest-queue", 1000, "ingest queue capacity; ServeHTTP returns 429 once full")
+	blockedRefresh := flag.Duration("blocked-refresh", 5*time.Minute, "interval at which the blocked accounts cache is refreshed from the database")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "timeout for reading request headers")
+	readTimeout := flag.Duration("read-timeout", 2*time.Minute, "timeout for reading the full request")
+	writeTimeout := flag.Duration("write-timeout", 2*time.Minute, "timeout for writing the response")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "keep-alive idle timeout")
+	tlsCert := flag.String("tls-cert", "", "path to a TLS certificate; enables HTTPS when set with -tls-key")
+	tlsKey := flag.String("tls-key", "", "path to a TLS private key; enables HTTPS when set with -tls-cert")
+	metricsAddr := flag.String("metrics-addr", ":9090", "address the Prometheus /metrics endpoint listens on")
 	flag.Parse()
 	if *accountsPtr <= 1 {
 		*accountsPtr = 2
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Read in connection string
 	var config *pgxpool.Config
 	var err error
@@ -164,19 +360,132 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbpool, err := pgxpool.ConnectConfig(context.Background(), config)
+	dbpool, err := pgxpool.ConnectConfig(ctx, config)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer dbpool.Close()
 
+	db = store.New()
+
+	blocked = newBlockedSet()
+	go refreshBlockedSet(ctx, dbpool, blocked, *blockedRefresh)
+
+	webhooks = newWebhookDispatcher(dbpool)
+	if err := webhooks.loadSubscriptions(ctx); err != nil {
+		log.Println("loading webhook subscriptions: ", err)
+	}
+	go webhooks.run(ctx)
+
 	clean(dbpool)
 	createAccounts(dbpool, accountsPtr)
-	go run(dbpool, accountsPtr, duration, wait)
+	var ready int32
+	atomic.StoreInt32(&ready, 1)
+
+	transferPool := workerpool.New(*transferWorkers * 2)
+	transferPool.Start(ctx, *transferWorkers)
+	go run(ctx, dbpool, accountsPtr, duration, transferPool, *tps)
+
+	ingestPool := workerpool.New(*ingestQueue)
+	ingestPool.Start(ctx, *ingestWorkers)
+
+	go monitorQueueDepth(ctx, transferPool, ingestPool)
+
+	metricsSrv := metrics.Serve(*metricsAddr)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", fraudDetector{pool: dbpool, ingest: ingestPool})
+	mux.Handle("/webhooks", webhooksHandler{dispatcher: webhooks})
+	mux.Handle("/webhooks/", webhooksHandler{dispatcher: webhooks})
+	mux.HandleFunc("/healthz", healthzHandler(dbpool))
+	mux.HandleFunc("/readyz", readyzHandler(&ready))
+	mux.Handle("/accounts", adminAccountsHandler{pool: dbpool})
+	mux.Handle("/accounts/", adminAccountsHandler{pool: dbpool})
+	mux.Handle("/anomalies", adminAnomaliesHandler{pool: dbpool})
+	mux.Handle("/blocked", adminBlockedHandler{pool: dbpool})
+	mux.Handle("/blocked/", adminBlockedHandler{pool: dbpool})
+	mux.Handle("/stats", adminStatsHandler{pool: dbpool})
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%v", port),
+		Handler:           mux,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
 
-	err = http.ListenAndServe(fmt.Sprintf(":%v", port), fraudDetector{pool: dbpool})
-	if err != nil {
-		panic(err)
+	serveErr := make(chan error, 1)
+	go func() {
+		if *tlsCert != "" && *tlsKey != "" {
+			serveErr <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+			return
+		}
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		log.Println("shutting down...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("graceful shutdown: ", err)
+		}
+
+		ingestPool.Close()
+		ingestPool.Wait()
+		transferPool.Close()
+		transferPool.Wait()
+
+		if err := metrics.Shutdown(shutdownCtx, metricsSrv); err != nil {
+			log.Println("metrics server shutdown: ", err)
+		}
+	}
+}
+
+// monitorQueueDepth periodically publishes the two worker pools' queue
+// depths as gauges, until ctx is done.
+func monitorQueueDepth(ctx context.Context, transferPool, ingestPool *workerpool.Pool) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			metrics.TransferQueueDepth.Set(float64(transferPool.Depth()))
+			metrics.IngestQueueDepth.Set(float64(ingestPool.Depth()))
+		}
+	}
+}
+
+// healthzHandler reports whether the database pool is reachable.
+func healthzHandler(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err := pool.Ping(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// readyzHandler reports whether initial account setup has completed.
+func readyzHandler(ready *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(ready) == 0 {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
 	}
 }
 
@@ -189,9 +498,10 @@ func createAccounts(pool *pgxpool.Pool, accounts *int) {
 	for i := 0; i < *accounts; i++ {
 		go func(pool *pgxpool.Pool, index int) {
 			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(index)))
 			id := uuid.New()
 			err := crdbpgx.ExecuteTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
-				return insertRows(context.Background(), tx, id, randomize(10, 1*1000*1000))
+				return insertRows(context.Background(), tx, id, randomize(rng, 10, 1*1000*1000))
 			})
 			if err == nil {
 				accountList.Store(index, id)
@@ -201,6 +511,7 @@ func createAccounts(pool *pgxpool.Pool, accounts *int) {
 		}(pool, i)
 	}
 	wg.Wait()
+	metrics.Accounts.Set(float64(*accounts))
 
 	log.Println("accounts created")
 }
@@ -238,102 +549,74 @@ func insertRows(ctx context.Context, tx pgx.Tx, acct uuid.UUID, balance int) err
 	return nil
 }
 
-func run(pool *pgxpool.Pool, accounts, duration, wait *int) {
-	// Run transfers
-	log.Printf("starting transfers for %d s", *duration)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*duration)*time.Second)
-	go callTransfer(ctx, pool, accounts, wait)
+// run drives the load generator for *duration seconds, submitting
+// transfer jobs to transferPool at a rate of tps jobs/s instead of a
+// serial time.Sleep loop, so throughput tracks DB capacity rather than a
+// fixed per-iteration delay.
+func run(ctx context.Context, pool *pgxpool.Pool, accounts, duration *int, transferPool *workerpool.Pool, tps float64) {
+	log.Printf("starting transfers for %d s at up to %.1f tps", *duration, tps)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(*duration)*time.Second)
+	defer cancel()
+
+	producer := workerpool.NewRateLimitedProducer(transferPool, tps)
+	producer.Run(ctx, func() workerpool.Job {
+		return func(ctx context.Context, rng *rand.Rand) {
+			executeTransfer(ctx, pool, accounts, rng)
+		}
+	})
 
-	//Cancel if too long
-	ct := time.Duration(*duration)
-	select {
-	case <-ctx.Done():
-		cancel()
-		return
-	case <-time.After(ct * time.Second):
-		log.Println("finished")
-		cancel()
-	}
+	log.Printf("done %d transfers (%d suspicious transfers detected)",
+		metrics.TransfersTotal.Value(), metrics.SuspiciousTransfersTotal.Value())
 }
 
-func callTransfer(ctx context.Context, pool *pgxpool.Pool, accounts, wait *int) {
-	w := time.Duration(*wait) * time.Millisecond
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("done %d transfers (%d suspicious transfers detected)", transfers, suspiciousTransfers)
-			return
-		default:
-			srcid := randomize(0, *accounts)
-			src, ok := accountList.Load(srcid)
-			if !ok {
-				log.Println("source account not found ", srcid)
-				return
-			}
-			dstid := randomize(0, *accounts)
-			dst, ok := accountList.Load(dstid)
-			if !ok {
-				log.Println("destination account not found ", dstid)
-				return
-			}
-			amount := randomize(minAmount, maxAmount)
-			err := crdbpgx.ExecuteTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
-				return transferFunds(context.Background(), tx, src.(uuid.UUID), dst.(uuid.UUID), amount)
-			})
-			if err != nil {
-				log.Println("error: ", err)
-			} else {
-				log.Printf("transfer from %s to %s of %d done.\n", src.(uuid.UUID), dst.(uuid.UUID), amount)
-			}
-			log.Printf("Waiting %d ms.", *wait)
-			time.Sleep(w)
-		}
+// executeTransfer picks a random source/destination/amount using rng
+// (owned by the calling transfer-pool worker) and runs the transfer.
+func executeTransfer(ctx context.Context, pool *pgxpool.Pool, accounts *int, rng *rand.Rand) {
+	srcid := randomize(rng, 0, *accounts)
+	src, ok := accountList.Load(srcid)
+	if !ok {
+		log.Println("source account not found ", srcid)
+		return
 	}
-}
-
-func transferFunds(ctx context.Context, tx pgx.Tx, from uuid.UUID, to uuid.UUID, amount int) error {
-	//Check for authorization
-	var isAuthorized sql.NullString
-	err := tx.QueryRow(ctx, "SELECT reason FROM blocked_accounts WHERE source = $1", from).Scan(&isAuthorized)
-
-	if err != nil && err.Error() != "no rows in result set" {
-		return err
+	dstid := randomize(rng, 0, *accounts)
+	dst, ok := accountList.Load(dstid)
+	if !ok {
+		log.Println("destination account not found ", dstid)
+		return
 	}
-
-	if isAuthorized.String != "" {
-		suspiciousTransfers++
-		return errors.New(isAuthorized.String)
+	amount := randomize(rng, minAmount, maxAmount)
+	err := crdbpgx.ExecuteTx(ctx, pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return transferFunds(ctx, tx, src.(uuid.UUID), dst.(uuid.UUID), amount)
+	})
+	if err != nil {
+		log.Println("error: ", err)
+	} else {
+		log.Printf("transfer from %s to %s of %d done.\n", src.(uuid.UUID), dst.(uuid.UUID), amount)
 	}
+}
 
-	// Read the balance.
-	var fromBalance int
-	if err := tx.QueryRow(ctx,
-		"SELECT balance FROM accounts WHERE id = $1", from).Scan(&fromBalance); err != nil {
-		return err
+func transferFunds(ctx context.Context, tx pgx.Tx, from uuid.UUID, to uuid.UUID, amount int) error {
+	start := time.Now()
+	defer func() { metrics.TransferDuration.Observe(time.Since(start).Seconds()) }()
+
+	//Check for authorization against the in-memory blocked set instead of
+	//a per-transfer round-trip to blocked_accounts.
+	if blockReason, isBlocked := blocked.reason(from); isBlocked {
+		metrics.SuspiciousTransfersTotal.Inc()
+		return &store.BlockedError{Reason: blockReason}
 	}
 
-	if fromBalance < amount {
-		return errors.New("insufficent funds")
-	}
-	// Perform the transfer.
-	if _, err := tx.Exec(ctx,
-		"UPDATE accounts SET balance = balance - $1 WHERE id = $2", amount, from); err != nil {
-		return err
-	}
-	if _, err := tx.Exec(ctx,
-		"UPDATE accounts SET balance = balance + $1 WHERE id = $2", amount, to); err != nil {
-		return err
-	}
-	tid := uuid.New()
-	if _, err := tx.Exec(ctx,
-		"INSERT INTO transfers (id, source, destination, amount) VALUES ($1, $2, $3, $4)", tid, from, to, amount); err != nil {
+	if err := db.TransferFunds(ctx, tx, from, to, amount); err != nil {
 		return err
 	}
-	transfers++
+	metrics.TransfersTotal.Inc()
 	return nil
 }
 
-func randomize(min, max int) int {
-	rand.Seed(time.Now().UnixNano())
-	return min + rand.Intn(max-min)
+// randomize returns a random int in [min, max) using rng. Callers that
+// run concurrently must each use their own *rand.Rand: reseeding and
+// reading from the shared global source on every call produces identical
+// values across goroutines invoked in the same nanosecond.
+func randomize(rng *rand.Rand, min, max int) int {
+	return min + rng.Intn(max-min)
 }
@@ -0,0 +1,113 @@
+// Package metrics exposes the loader and fraud-detector counters used to
+// be log-only (transfers, suspiciousTransfers) as Prometheus metrics,
+// served on their own HTTP server so they can be scraped independently of
+// the ingest port.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Counter wraps a prometheus.Counter with an atomic.Int64 kept in lockstep,
+// so callers that need the current value back (e.g. the admin stats
+// endpoint, or a shutdown summary log line) don't have to reach for
+// prometheus/testutil, which is meant for tests, not production reads.
+type Counter struct {
+	prometheus.Counter
+	value atomic.Int64
+}
+
+func newCounter(opts prometheus.CounterOpts) *Counter {
+	return &Counter{Counter: promauto.NewCounter(opts)}
+}
+
+// Inc increments both the Prometheus counter and the value Value returns.
+func (c *Counter) Inc() {
+	c.Counter.Inc()
+	c.value.Add(1)
+}
+
+// Value returns the counter's current value.
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+var (
+	TransfersTotal = newCounter(prometheus.CounterOpts{
+		Name: "loader_transfers_total",
+		Help: "Total number of transfers completed.",
+	})
+	SuspiciousTransfersTotal = newCounter(prometheus.CounterOpts{
+		Name: "loader_suspicious_transfers_total",
+		Help: "Total number of transfers rejected because the source account was blocked.",
+	})
+	AnomaliesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loader_anomalies_total",
+		Help: "Total number of anomalies recorded, by level.",
+	}, []string{"level"})
+	BlocksTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "loader_blocks_total",
+		Help: "Total number of accounts added to blocked_accounts.",
+	})
+
+	Accounts = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loader_accounts",
+		Help: "Number of accounts created by this loader instance.",
+	})
+	BlockedAccounts = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loader_blocked_accounts",
+		Help: "Current size of the in-memory blocked accounts cache.",
+	})
+
+	TransferQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loader_transfer_queue_depth",
+		Help: "Number of transfer jobs currently queued for the transfer worker pool.",
+	})
+	IngestQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loader_ingest_queue_depth",
+		Help: "Number of ingest jobs currently queued for the ingest worker pool.",
+	})
+
+	TransferDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "loader_transfer_duration_seconds",
+		Help:    "Time taken to execute a transfer transaction.",
+		Buckets: prometheus.DefBuckets,
+	})
+	IngestBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "loader_ingest_batch_size",
+		Help:    "Number of newline-separated lines in a single fraud-detector request body.",
+		Buckets: prometheus.LinearBuckets(1, 5, 10),
+	})
+)
+
+// Serve starts a dedicated *http.Server exposing /metrics on addr. The
+// caller is responsible for shutting it down (mirrors how the main
+// ingest server is managed in main.go).
+func Serve(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+	return srv
+}
+
+// Shutdown gracefully stops the metrics server.
+func Shutdown(ctx context.Context, srv *http.Server) error {
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,22 @@
+package store
+
+import "errors"
+
+// ErrNoRows is returned in place of a pgx "no rows in result set" error,
+// so callers can use errors.Is instead of comparing error strings (which
+// is fragile across pgx versions).
+var ErrNoRows = errors.New("store: no rows")
+
+// ErrInsufficientFunds is returned by TransferFunds when the source
+// account's balance is lower than the requested amount.
+var ErrInsufficientFunds = errors.New("store: insufficient funds")
+
+// BlockedError is returned by IsBlocked when the account is blocked; it
+// carries the reason recorded in blocked_accounts.
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return e.Reason
+}
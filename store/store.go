@@ -0,0 +1,121 @@
+// Package store holds typed, parameterized queries for the
+// fraud-detection path (anomalies, blocked accounts, transfers), in one
+// place instead of scattered across main.go, so the logic around them can
+// be unit tested against a mock or a real CockroachDB instance. Its
+// methods run on a pgx.Tx supplied by the caller; the package does not
+// hold or wrap a pgxpool.Pool.
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+// Store executes queries against the loader schema using whatever
+// pgx.Tx the caller is driving (main.go runs everything inside
+// crdbpgx.ExecuteTx). Store itself holds no state, no pool included.
+type Store struct{}
+
+// New returns a Store. It takes no arguments today but exists as the
+// constructor call site for future pool-level state (e.g. prepared
+// statements).
+func New() *Store {
+	return &Store{}
+}
+
+// AnomalyLevel reports the anomaly level CockroachDB computed for
+// message id, or ErrNoRows if anomalyLevel returned nothing.
+func (s *Store) AnomalyLevel(ctx context.Context, tx pgx.Tx, id string) (string, error) {
+	var level string
+	err := tx.QueryRow(ctx, "SELECT anomalyLevel($1)", id).Scan(&level)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrNoRows
+		}
+		return "", err
+	}
+	return level, nil
+}
+
+// InsertAnomaly records an anomaly for a source/destination pair.
+func (s *Store) InsertAnomaly(ctx context.Context, tx pgx.Tx, source, destination, level string) error {
+	_, err := tx.Exec(ctx,
+		"INSERT INTO anomalies (source, destination, level) VALUES ($1, $2, $3)", source, destination, level)
+	return err
+}
+
+// CountAnomaliesBySource returns the number of anomalies recorded for
+// source, grouped by level.
+func (s *Store) CountAnomaliesBySource(ctx context.Context, tx pgx.Tx, source string) (map[string]int, error) {
+	rows, err := tx.Query(ctx,
+		"SELECT anomaly_level, count(*) FROM transfers WHERE source = $1 GROUP BY anomaly_level", source)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNoRows
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var level string
+		var count int
+		if err := rows.Scan(&level, &count); err != nil {
+			return nil, err
+		}
+		counts[level] = count
+	}
+	return counts, rows.Err()
+}
+
+// InsertBlockedAccount adds source to blocked_accounts with reason.
+func (s *Store) InsertBlockedAccount(ctx context.Context, tx pgx.Tx, source, reason string) error {
+	_, err := tx.Exec(ctx, "INSERT INTO blocked_accounts (source, reason) VALUES ($1, $2)", source, reason)
+	return err
+}
+
+// IsBlocked reports whether source is present in blocked_accounts,
+// returning a *BlockedError carrying the recorded reason if so.
+func (s *Store) IsBlocked(ctx context.Context, tx pgx.Tx, source uuid.UUID) error {
+	var blockReason string
+	err := tx.QueryRow(ctx, "SELECT reason FROM blocked_accounts WHERE source = $1", source).Scan(&blockReason)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return &BlockedError{Reason: blockReason}
+}
+
+// TransferFunds moves amount from from to to, recording the transfer.
+// It returns ErrInsufficientFunds if from's balance is too low.
+func (s *Store) TransferFunds(ctx context.Context, tx pgx.Tx, from, to uuid.UUID, amount int) error {
+	var fromBalance int
+	if err := tx.QueryRow(ctx,
+		"SELECT balance FROM accounts WHERE id = $1", from).Scan(&fromBalance); err != nil {
+		return err
+	}
+	if fromBalance < amount {
+		return ErrInsufficientFunds
+	}
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE accounts SET balance = balance - $1 WHERE id = $2", amount, from); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		"UPDATE accounts SET balance = balance + $1 WHERE id = $2", amount, to); err != nil {
+		return err
+	}
+
+	tid := uuid.New()
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO transfers (id, source, destination, amount) VALUES ($1, $2, $3, $4)", tid, from, to, amount); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+)
+
+func newMockTx(t *testing.T) pgxmock.PgxConnIface {
+	t.Helper()
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("pgxmock.NewConn: %v", err)
+	}
+	t.Cleanup(func() { mock.Close(context.Background()) })
+	return mock
+}
+
+func TestCountAnomaliesBySource(t *testing.T) {
+	mock := newMockTx(t)
+	s := New()
+
+	rows := pgxmock.NewRows([]string{"anomaly_level", "count"}).
+		AddRow("low", 2).
+		AddRow("high", 1)
+	mock.ExpectQuery("SELECT anomaly_level, count\\(\\*\\) FROM transfers WHERE source = \\$1 GROUP BY anomaly_level").
+		WithArgs("acct-1").
+		WillReturnRows(rows)
+
+	counts, err := s.CountAnomaliesBySource(context.Background(), mock, "acct-1")
+	if err != nil {
+		t.Fatalf("CountAnomaliesBySource: %v", err)
+	}
+	if counts["low"] != 2 || counts["high"] != 1 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCountAnomaliesBySourceNoRows(t *testing.T) {
+	mock := newMockTx(t)
+	s := New()
+
+	mock.ExpectQuery("SELECT anomaly_level, count\\(\\*\\) FROM transfers WHERE source = \\$1 GROUP BY anomaly_level").
+		WithArgs("acct-1").
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := s.CountAnomaliesBySource(context.Background(), mock, "acct-1")
+	if !errors.Is(err, ErrNoRows) {
+		t.Fatalf("got %v, want ErrNoRows", err)
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	mock := newMockTx(t)
+	s := New()
+	source := uuid.New()
+
+	mock.ExpectQuery("SELECT reason FROM blocked_accounts WHERE source = \\$1").
+		WithArgs(source).
+		WillReturnRows(pgxmock.NewRows([]string{"reason"}).AddRow("too many anomalies"))
+
+	err := s.IsBlocked(context.Background(), mock, source)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("got %v, want *BlockedError", err)
+	}
+	if blocked.Reason != "too many anomalies" {
+		t.Fatalf("got reason %q", blocked.Reason)
+	}
+}
+
+func TestIsBlockedNotBlocked(t *testing.T) {
+	mock := newMockTx(t)
+	s := New()
+	source := uuid.New()
+
+	mock.ExpectQuery("SELECT reason FROM blocked_accounts WHERE source = \\$1").
+		WithArgs(source).
+		WillReturnError(pgx.ErrNoRows)
+
+	if err := s.IsBlocked(context.Background(), mock, source); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
+func TestTransferFunds(t *testing.T) {
+	mock := newMockTx(t)
+	s := New()
+	from, to := uuid.New(), uuid.New()
+
+	mock.ExpectQuery("SELECT balance FROM accounts WHERE id = \\$1").
+		WithArgs(from).
+		WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(500))
+	mock.ExpectExec("UPDATE accounts SET balance = balance - \\$1 WHERE id = \\$2").
+		WithArgs(100, from).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE accounts SET balance = balance \\+ \\$1 WHERE id = \\$2").
+		WithArgs(100, to).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO transfers \\(id, source, destination, amount\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs(pgxmock.AnyArg(), from, to, 100).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	if err := s.TransferFunds(context.Background(), mock, from, to, 100); err != nil {
+		t.Fatalf("TransferFunds: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestTransferFundsInsufficientFunds(t *testing.T) {
+	mock := newMockTx(t)
+	s := New()
+	from, to := uuid.New(), uuid.New()
+
+	mock.ExpectQuery("SELECT balance FROM accounts WHERE id = \\$1").
+		WithArgs(from).
+		WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(50))
+
+	err := s.TransferFunds(context.Background(), mock, from, to, 100)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("got %v, want ErrInsufficientFunds", err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	webhookQueueSize   = 256
+	webhookWorkers     = 4
+	webhookMaxAttempts = 5
+	webhookTimeout     = 5 * time.Second
+)
+
+// webhookEvent is the JSON payload delivered to subscribers.
+type webhookEvent struct {
+	Event      string    `json:"event"`
+	Account    string    `json:"account"`
+	Level      string    `json:"level,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	TransferID string    `json:"transfer_id,omitempty"`
+	Ts         time.Time `json:"ts"`
+}
+
+const (
+	eventAnomaly = "anomaly"
+	eventBlock   = "block"
+)
+
+// webhookSubscription is a registered listener for loader events,
+// persisted in the webhooks table.
+type webhookSubscription struct {
+	ID     uuid.UUID `json:"id"`
+	URL    string    `json:"url"`
+	Events []string  `json:"events"`
+	Secret string    `json:"-"`
+}
+
+func (s webhookSubscription) wants(event string) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDispatcher owns the registered subscriptions and a bounded
+// in-process queue drained by a small worker pool, so that inserting an
+// anomaly or a blocked account never blocks on an operator's endpoint.
+// subs is read by worker() on every delivered event and by list(), and
+// written by loadSubscriptions at startup and by register/unregister from
+// HTTP handler goroutines, so all access goes through mu.
+type webhookDispatcher struct {
+	pool   *pgxpool.Pool
+	mu     sync.RWMutex
+	subs   []webhookSubscription
+	queue  chan webhookEvent
+	client *http.Client
+}
+
+func newWebhookDispatcher(pool *pgxpool.Pool) *webhookDispatcher {
+	return &webhookDispatcher{
+		pool:   pool,
+		queue:  make(chan webhookEvent, webhookQueueSize),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// loadSubscriptions populates the dispatcher from the webhooks table. It
+// is called once at startup; subscribers added or removed afterwards are
+// applied write-through by register/unregister.
+func (d *webhookDispatcher) loadSubscriptions(ctx context.Context) error {
+	rows, err := d.pool.Query(ctx, "SELECT id, url, events, secret FROM webhooks")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var subs []webhookSubscription
+	for rows.Next() {
+		var s webhookSubscription
+		if err := rows.Scan(&s.ID, &s.URL, &s.Events, &s.Secret); err != nil {
+			return err
+		}
+		subs = append(subs, s)
+	}
+
+	d.mu.Lock()
+	d.subs = subs
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *webhookDispatcher) register(ctx context.Context, s webhookSubscription) error {
+	s.ID = uuid.New()
+	if _, err := d.pool.Exec(ctx, "INSERT INTO webhooks (id, url, events, secret) VALUES ($1, $2, $3, $4)", s.ID, s.URL, s.Events, s.Secret); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.subs = append(d.subs, s)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *webhookDispatcher) unregister(ctx context.Context, id uuid.UUID) error {
+	if _, err := d.pool.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	for i, s := range d.subs {
+		if s.ID == id {
+			d.subs = append(d.subs[:i], d.subs[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// matching returns a snapshot of the subscriptions registered for event,
+// safe to range over without holding mu (deliver can block on network
+// I/O for a while).
+func (d *webhookDispatcher) matching(event string) []webhookSubscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var matched []webhookSubscription
+	for _, s := range d.subs {
+		if s.wants(event) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// list returns a snapshot of all registered subscriptions.
+func (d *webhookDispatcher) list() []webhookSubscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := make([]webhookSubscription, len(d.subs))
+	copy(out, d.subs)
+	return out
+}
+
+// enqueue hands an event to the worker pool, dropping it with a log line
+// if the queue is saturated rather than blocking the caller.
+func (d *webhookDispatcher) enqueue(ev webhookEvent) {
+	select {
+	case d.queue <- ev:
+	default:
+		log.Printf("webhook queue full, dropping %s event for %s", ev.Event, ev.Account)
+	}
+}
+
+// run starts the worker pool and blocks until ctx is done.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	for i := 0; i < webhookWorkers; i++ {
+		go d.worker(ctx)
+	}
+	<-ctx.Done()
+}
+
+func (d *webhookDispatcher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-d.queue:
+			for _, s := range d.matching(ev.Event) {
+				d.deliver(ctx, s, ev)
+			}
+		}
+	}
+}
+
+// deliver POSTs ev to s.URL with an HMAC-SHA256 signature of the body,
+// retrying with exponential backoff until webhookMaxAttempts is reached.
+func (d *webhookDispatcher) deliver(ctx context.Context, s webhookSubscription, ev webhookEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Println("webhook marshal: ", err)
+		return
+	}
+	sig := sign(s.Secret, body)
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Webhook-Signature", sig)
+			resp, err := d.client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode < 300 {
+					return
+				}
+				err = fmt.Errorf("webhook %s responded %d", s.URL, resp.StatusCode)
+			}
+			log.Printf("webhook delivery to %s failed (attempt %d/%d): %v", s.URL, attempt, webhookMaxAttempts, err)
+		}
+
+		if attempt == webhookMaxAttempts {
+			log.Printf("webhook delivery to %s dropped after %d attempts", s.URL, webhookMaxAttempts)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhooksHandler exposes the subscription management API:
+// POST/GET /webhooks and DELETE /webhooks/{id}.
+type webhooksHandler struct {
+	dispatcher *webhookDispatcher
+}
+
+func (h webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/webhooks")
+	id = strings.Trim(id, "/")
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		h.create(w, r)
+	case r.Method == http.MethodGet && id == "":
+		h.list(w, r)
+	case r.Method == http.MethodDelete && id != "":
+		h.delete(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h webhooksHandler) create(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.URL == "" || len(in.Events) == 0 {
+		http.Error(w, "url and events are required", http.StatusBadRequest)
+		return
+	}
+
+	s := webhookSubscription{URL: in.URL, Events: in.Events, Secret: in.Secret}
+	if err := h.dispatcher.register(r.Context(), s); err != nil {
+		log.Println("webhook register: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h webhooksHandler) list(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.dispatcher.list())
+}
+
+func (h webhooksHandler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := h.dispatcher.unregister(r.Context(), parsed); err != nil {
+		log.Println("webhook unregister: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestDispatcherSubsRace exercises concurrent reads (matching/list) against
+// writes of subs: under `go test -race` this used to report a data race
+// before subs was guarded by mu.
+func TestDispatcherSubsRace(t *testing.T) {
+	d := &webhookDispatcher{}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			d.mu.Lock()
+			d.subs = append(d.subs, webhookSubscription{ID: uuid.New(), Events: []string{eventAnomaly}})
+			d.mu.Unlock()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			d.matching(eventAnomaly)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			d.list()
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,34 @@
+package workerpool
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedProducer calls a produce function at up to a target rate and
+// submits the resulting Job to a Pool, replacing a serial
+// time.Sleep(wait) loop with throughput that tracks DB capacity rather
+// than a fixed per-iteration delay.
+type RateLimitedProducer struct {
+	pool    *Pool
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedProducer builds a producer that feeds pool at up to tps
+// jobs per second.
+func NewRateLimitedProducer(pool *Pool, tps float64) *RateLimitedProducer {
+	return &RateLimitedProducer{pool: pool, limiter: rate.NewLimiter(rate.Limit(tps), 1)}
+}
+
+// Run blocks until ctx is done, calling produce at the target rate and
+// submitting each resulting Job to the pool. A job dropped because the
+// pool is saturated is simply skipped for that tick.
+func (p *RateLimitedProducer) Run(ctx context.Context, produce func() Job) {
+	for {
+		if err := p.limiter.Wait(ctx); err != nil {
+			return
+		}
+		p.pool.Submit(produce())
+	}
+}
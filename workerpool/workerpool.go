@@ -0,0 +1,106 @@
+// Package workerpool provides small, bounded worker pools used in place
+// of unbounded "go func()" fan-out: a fixed number of goroutines pull
+// Jobs from a capacity-limited channel, so producers can be told "no"
+// (queue full) instead of piling up unbounded goroutines.
+package workerpool
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Job is a unit of work handed to a worker. Each worker owns a private
+// *rand.Rand seeded once at startup, so jobs that need randomness (e.g.
+// picking an account) don't race on the global rand source the way
+// repeatedly reseeding it on every call would.
+type Job func(ctx context.Context, rng *rand.Rand)
+
+// Pool runs a fixed number of workers consuming Jobs from a
+// capacity-bounded channel.
+type Pool struct {
+	jobs chan Job
+	wg   sync.WaitGroup
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// New creates a Pool with the given queue capacity. Call Start to launch
+// its workers.
+func New(queueSize int) *Pool {
+	return &Pool{jobs: make(chan Job, queueSize)}
+}
+
+// Start launches workers workers, each running until ctx is done, or until
+// the pool is closed and its queue is empty.
+func (p *Pool) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker(ctx, i)
+	}
+}
+
+func (p *Pool) worker(ctx context.Context, id int) {
+	defer p.wg.Done()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			job(ctx, rng)
+		}
+	}
+}
+
+// Submit enqueues job without blocking. It reports whether the job was
+// accepted; a false return means either the queue is saturated or the
+// pool has been closed, and the caller (e.g. an HTTP handler) should
+// respond accordingly (429).
+//
+// Submit holds a read lock across the send so that it can never race
+// with Close: Close takes the write lock before closing the channel, so
+// it always waits for any in-flight Submit to finish first.
+func (p *Pool) Submit(job Job) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return false
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Depth reports the number of jobs currently queued.
+func (p *Pool) Depth() int {
+	return len(p.jobs)
+}
+
+// Close stops accepting new jobs: subsequent Submit calls return false
+// instead of sending on the now-closed channel. Call Wait afterwards to
+// let in-flight and already-queued jobs drain. Queued jobs are drained
+// only while the ctx passed to Start is not done: once it is, each worker
+// returns after its current job and jobs still in the queue are not run.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+	close(p.jobs)
+}
+
+// Wait blocks until all workers have exited.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
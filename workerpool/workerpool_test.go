@@ -0,0 +1,29 @@
+package workerpool
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// TestSubmitCloseRace exercises Submit and Close concurrently: under
+// `go test -race` this used to panic with "send on closed channel"
+// before Submit/Close were synchronized against each other.
+func TestSubmitCloseRace(t *testing.T) {
+	p := New(1)
+	p.Start(context.Background(), 2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			p.Submit(func(ctx context.Context, rng *rand.Rand) {})
+		}
+	}()
+
+	p.Close()
+	wg.Wait()
+	p.Wait()
+}